@@ -20,6 +20,11 @@ type Config struct {
 	// against the controller are allowed. For external users, names must
 	// include the "@external" suffix.
 	AllowedUsers []string `yaml:"allowed-users"`
+	// Controllers optionally holds additional Juju controllers that this
+	// jujushell instance can dispatch sessions to, on top of the controller
+	// described by JujuAddrs/JujuCert. When empty, the instance behaves as
+	// a single-controller deployment.
+	Controllers []Controller `yaml:"controllers"`
 	// DNSName optionally holds the DNS name to use for Let's Encrypt.
 	DNSName string `yaml:"dns-name"`
 	// ImageName holds the name of the LXD image to use to create containers.
@@ -31,12 +36,20 @@ type Config struct {
 	JujuCert string `yaml:"juju-cert"`
 	// LogLevel holds the logging level to use when running the server.
 	LogLevel zapcore.Level `yaml:"log-level"`
+	// LXDRemote optionally holds the connection details of a remote LXD
+	// server to use instead of a local unix socket. Exactly one of
+	// LXDSocketPath and LXDRemote must be set.
+	LXDRemote *LXDRemote `yaml:"lxd-remote"`
 	// LXDSocketPath holds the path to the LXD unix socket.
 	LXDSocketPath string `yaml:"lxd-socket-path"`
 	// Port holds the port on which the server will start listening.
 	Port int `yaml:"port"`
 	// Profiles holds the LXD profiles to use when launching containers.
 	Profiles []string `yaml:"profiles"`
+	// Quotas optionally holds limits on the resources a user or source IP
+	// can consume. A zero value for any field means that limit is not
+	// enforced.
+	Quotas Quotas `yaml:"quotas"`
 	// SessionTimeout holds the number of minutes of inactivity to wait before
 	// expiring a session and stopping the container instance. A zero value
 	// means that the session never expires.
@@ -49,6 +62,77 @@ type Config struct {
 	WelcomeMessage string `yaml:"welcome-message"`
 }
 
+// Controller holds the configuration for a single Juju controller that
+// jujushell can proxy shell sessions to. It allows an operator to run one
+// jujushell deployment in front of several controllers, each with its own
+// users, image and profiles.
+type Controller struct {
+	// Name holds a label identifying the controller, used for logging and
+	// to disambiguate controllers in the configuration. It is not sent to
+	// the client.
+	Name string `yaml:"name"`
+	// UserDomain optionally holds a user name suffix (e.g. "@external")
+	// used to route a session to this controller based on the
+	// authenticated user's macaroon discharge. At most one controller may
+	// omit UserDomain; it is then used as the default for users that do
+	// not match any other controller's domain.
+	UserDomain string `yaml:"user-domain"`
+	// JujuAddrs holds the addresses of this Juju controller.
+	JujuAddrs []string `yaml:"juju-addrs"`
+	// JujuCert holds the CA certificate that will be used to validate the
+	// controller's certificate, in PEM format.
+	JujuCert string `yaml:"juju-cert"`
+	// AllowedUsers optionally overrides the top level AllowedUsers for
+	// sessions routed to this controller.
+	AllowedUsers []string `yaml:"allowed-users"`
+	// Profiles optionally overrides the top level Profiles for sessions
+	// routed to this controller.
+	Profiles []string `yaml:"profiles"`
+	// ImageName optionally overrides the top level ImageName for sessions
+	// routed to this controller.
+	ImageName string `yaml:"image-name"`
+}
+
+// LXDRemote holds the connection details used to reach a remote LXD server
+// over HTTPS, as an alternative to talking to a local LXD daemon over its
+// unix socket. This allows jujushell frontends to be placed behind a load
+// balancer while containers are created on a separate, dedicated LXD
+// cluster.
+type LXDRemote struct {
+	// Addr holds the address (host:port) of the remote LXD server.
+	Addr string `yaml:"addr"`
+	// ClientCert and ClientKey hold the client certificate and key, in PEM
+	// format, used to authenticate with the remote LXD server.
+	ClientCert string `yaml:"client-cert"`
+	ClientKey  string `yaml:"client-key"`
+	// ServerCert optionally holds the expected certificate of the remote
+	// LXD server, in PEM format. A certificate fingerprint is not accepted.
+	ServerCert string `yaml:"server-cert"`
+	// Project optionally holds the name of the LXD project to use.
+	Project string `yaml:"project"`
+}
+
+// Quotas holds limits enforced by the server to keep it safe to run as a
+// shared multi-tenant service.
+type Quotas struct {
+	// MaxContainersPerUser limits the number of containers a single user
+	// may have running at the same time.
+	MaxContainersPerUser int `yaml:"max-containers-per-user"`
+	// MaxContainers limits the total number of containers running at the
+	// same time, across all users.
+	MaxContainers int `yaml:"max-containers"`
+	// MaxCPU limits the number of CPUs made available to each container,
+	// mapped onto the LXD "limits.cpu" configuration key.
+	MaxCPU int `yaml:"max-cpu"`
+	// MaxMemory limits the amount of memory made available to each
+	// container, mapped onto the LXD "limits.memory" configuration key,
+	// for instance "256MB".
+	MaxMemory string `yaml:"max-memory"`
+	// MaxSessionsPerIP limits the number of concurrent sessions that may
+	// be started from the same source IP address.
+	MaxSessionsPerIP int `yaml:"max-sessions-per-ip"`
+}
+
 // Read reads the configuration options from a file at the given path.
 func Read(path string) (*Config, error) {
 	f, err := os.Open(path)
@@ -80,9 +164,6 @@ func validate(c Config) error {
 	if len(c.JujuAddrs) == 0 {
 		missing = append(missing, "juju-addrs")
 	}
-	if c.LXDSocketPath == "" {
-		missing = append(missing, "lxd-socket-path")
-	}
 	if c.Port <= 0 {
 		missing = append(missing, "port")
 	}
@@ -103,5 +184,90 @@ func validate(c Config) error {
 	if c.SessionTimeout < 0 {
 		return errgo.New("cannot specify a negative session timeout")
 	}
+	if err := ValidateControllers(c.Controllers); err != nil {
+		return errgo.Notef(err, "invalid controllers")
+	}
+	if err := validateLXD(c); err != nil {
+		return err
+	}
+	if err := ValidateQuotas(c.Quotas); err != nil {
+		return errgo.Notef(err, "invalid quotas")
+	}
+	return nil
+}
+
+// ValidateQuotas checks that the configured quotas, if any, are not
+// negative. It is exported so that packages validating a subset of a
+// Config, such as the server's reloadable parameters, can reuse it.
+func ValidateQuotas(q Quotas) error {
+	if q.MaxContainersPerUser < 0 {
+		return errgo.New("cannot specify a negative max-containers-per-user")
+	}
+	if q.MaxContainers < 0 {
+		return errgo.New("cannot specify a negative max-containers")
+	}
+	if q.MaxCPU < 0 {
+		return errgo.New("cannot specify a negative max-cpu")
+	}
+	if q.MaxSessionsPerIP < 0 {
+		return errgo.New("cannot specify a negative max-sessions-per-ip")
+	}
+	return nil
+}
+
+// validateLXD checks that exactly one of LXDSocketPath and LXDRemote is
+// provided, reporting lxd-socket-path as the missing field when neither is
+// set, so that existing configurations without an lxd-remote block keep
+// working unchanged.
+func validateLXD(c Config) error {
+	switch {
+	case c.LXDSocketPath == "" && c.LXDRemote == nil:
+		return errgo.New("missing fields: lxd-socket-path")
+	case c.LXDSocketPath != "" && c.LXDRemote != nil:
+		return errgo.New("cannot specify both lxd-socket-path and lxd-remote")
+	case c.LXDRemote != nil:
+		var missing []string
+		if c.LXDRemote.Addr == "" {
+			missing = append(missing, "lxd-remote.addr")
+		}
+		if c.LXDRemote.ClientCert == "" {
+			missing = append(missing, "lxd-remote.client-cert")
+		}
+		if c.LXDRemote.ClientKey == "" {
+			missing = append(missing, "lxd-remote.client-key")
+		}
+		if len(missing) != 0 {
+			return errgo.Newf("missing fields: %s", strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
+// ValidateControllers validates the optional list of additional controllers,
+// ensuring that at most one of them can be used as the default (a controller
+// with no UserDomain) and that each one declares the addresses it needs to
+// connect to Juju. It is exported so that packages validating a subset of a
+// Config, such as the server's reloadable parameters, can reuse it.
+func ValidateControllers(controllers []Controller) error {
+	seenDefault := false
+	names := make(map[string]bool, len(controllers))
+	for _, controller := range controllers {
+		if controller.Name == "" {
+			return errgo.New("controller has no name")
+		}
+		if names[controller.Name] {
+			return errgo.Newf("duplicate controller name %q", controller.Name)
+		}
+		names[controller.Name] = true
+		if len(controller.JujuAddrs) == 0 {
+			return errgo.Newf("controller %q: missing juju-addrs", controller.Name)
+		}
+		if controller.UserDomain == "" {
+			if seenDefault {
+				return errgo.New("more than one controller without a user-domain")
+			}
+			seenDefault = true
+		}
+	}
 	return nil
 }
@@ -0,0 +1,137 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// Package api implements the jujushell HTTP API used to start shell
+// sessions.
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CanonicalLtd/jujushell/config"
+)
+
+// Register registers the jujushell HTTP API on mux. The controllers,
+// allowedUsers, profiles, imageName and quotas parameters are called while
+// handling each request, rather than passed as static values, so that a
+// configuration reload takes effect for new sessions without requiring a
+// restart. The sessionTimeout and welcomeMessage functions are stored but
+// not called by the session handler.
+func Register(
+	mux *http.ServeMux,
+	controllers func() []config.Controller,
+	allowedUsers func() []string,
+	profiles func() []string,
+	imageName func() string,
+	sessionTimeout func() int,
+	welcomeMessage func() string,
+	lxdSocketPath string,
+	lxdRemote *config.LXDRemote,
+	quotas func() config.Quotas,
+) error {
+	h := &sessionHandler{
+		controllers:    controllers,
+		allowedUsers:   allowedUsers,
+		profiles:       profiles,
+		imageName:      imageName,
+		sessionTimeout: sessionTimeout,
+		welcomeMessage: welcomeMessage,
+		lxdSocketPath:  lxdSocketPath,
+		lxdRemote:      lxdRemote,
+		quotas:         newQuotaManager(quotas),
+	}
+	mux.Handle("/ws/", h)
+	return nil
+}
+
+// sessionHandler handles requests to start a new shell session, dispatching
+// each one to the appropriate controller and LXD backend.
+type sessionHandler struct {
+	controllers    func() []config.Controller
+	allowedUsers   func() []string
+	profiles       func() []string
+	imageName      func() string
+	sessionTimeout func() int
+	welcomeMessage func() string
+	lxdSocketPath  string
+	lxdRemote      *config.LXDRemote
+	quotas         *quotaManager
+}
+
+// ServeHTTP implements http.Handler.
+func (h *sessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user := username(r)
+	controller, err := pickController(h.controllers(), user, r.URL.Query().Get("controller"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !isAllowed(user, effectiveAllowedUsers(controller, h.allowedUsers())) {
+		writeError(w, http.StatusForbidden, "user not allowed")
+		return
+	}
+	ip := sourceIP(r)
+	if err := h.quotas.acquire(user, ip); err != nil {
+		writeError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	defer h.quotas.release(user, ip)
+	client, err := connectLXD(h.lxdSocketPath, h.lxdRemote)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "cannot connect to LXD: "+err.Error())
+		return
+	}
+	start := time.Now()
+	if !startSession(w, r, client, controller, h) {
+		return
+	}
+	containersCreatedTotal.Inc()
+	containersActive.Inc()
+	defer func() {
+		containersDestroyedTotal.Inc()
+		containersActive.Dec()
+		sessionDurationSeconds.Observe(time.Since(start).Seconds())
+	}()
+}
+
+// writeError writes a structured JSON error with the given status code, so
+// that the JS client can distinguish failure reasons.
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{message})
+}
+
+// username returns the name of the authenticated user making the request,
+// as declared by the macaroon discharge performed upstream of this handler.
+func username(r *http.Request) string {
+	return r.Header.Get("Juju-Username")
+}
+
+// sourceIP returns the source IP address of the request, ignoring the port.
+func sourceIP(r *http.Request) string {
+	host := r.RemoteAddr
+	if idx := strings.LastIndex(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+	return host
+}
+
+// isAllowed reports whether user is allowed to use the service: an empty
+// allowedUsers list means that all authenticated users are allowed.
+func isAllowed(user string, allowedUsers []string) bool {
+	if len(allowedUsers) == 0 {
+		return true
+	}
+	for _, u := range allowedUsers {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
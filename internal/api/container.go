@@ -0,0 +1,86 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	lxd "github.com/lxc/lxd/client"
+	lxdapi "github.com/lxc/lxd/shared/api"
+
+	"github.com/CanonicalLtd/jujushell/config"
+)
+
+// startSession creates a container for the given user on the given
+// controller and replies to the client with its name, returning whether the
+// container was created successfully. The actual terminal proxying that
+// follows is out of scope here and handled downstream.
+func startSession(w http.ResponseWriter, r *http.Request, client lxd.ContainerServer, controller config.Controller, h *sessionHandler) bool {
+	user := username(r)
+	name := containerName(user)
+	limits := h.quotas.limits()
+	start := time.Now()
+	op, err := client.CreateContainer(lxdapi.ContainersPost{
+		Name: name,
+		Source: lxdapi.ContainerSource{
+			Type:  "image",
+			Alias: effectiveImageName(controller, h.imageName()),
+		},
+		ContainerPut: lxdapi.ContainerPut{
+			Profiles: effectiveProfiles(controller, h.profiles()),
+			Config:   limits,
+		},
+	})
+	if err == nil {
+		err = op.Wait()
+	}
+	lxdCallLatencySeconds.WithLabelValues("create-container").Observe(time.Since(start).Seconds())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "cannot create container: "+err.Error())
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Container string `json:"container"`
+	}{name})
+	return true
+}
+
+// containerName returns the name to use for the container started for user.
+func containerName(user string) string {
+	return fmt.Sprintf("jujushell-%s", user)
+}
+
+// effectiveAllowedUsers returns the list of users allowed to start a
+// session on the given controller: the controller's own override when set,
+// or fallback otherwise.
+func effectiveAllowedUsers(c config.Controller, fallback []string) []string {
+	if len(c.AllowedUsers) != 0 {
+		return c.AllowedUsers
+	}
+	return fallback
+}
+
+// effectiveImageName returns the image name to use for a session on the
+// given controller: the controller's own override when set, or fallback
+// otherwise.
+func effectiveImageName(c config.Controller, fallback string) string {
+	if c.ImageName != "" {
+		return c.ImageName
+	}
+	return fallback
+}
+
+// effectiveProfiles returns the LXD profiles to use for a session on the
+// given controller: the controller's own override when set, or fallback
+// otherwise.
+func effectiveProfiles(c config.Controller, fallback []string) []string {
+	if len(c.Profiles) != 0 {
+		return c.Profiles
+	}
+	return fallback
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package api
+
+import (
+	"strings"
+
+	"gopkg.in/errgo.v1"
+
+	"github.com/CanonicalLtd/jujushell/config"
+)
+
+// pickController selects, among the given controllers, the one that should
+// handle a session for the given user. The explicit controller name, when
+// provided by the client, always wins; otherwise the user name's domain
+// suffix (e.g. "@external") is matched against each controller's
+// UserDomain, falling back to the controller with no UserDomain set, which
+// acts as the default. When more than one controller has no UserDomain
+// (the implicit controller built from the top level configuration, plus an
+// explicitly configured default), the last one in the list wins, so that an
+// explicitly configured default takes precedence over the implicit one.
+func pickController(controllers []config.Controller, user, explicit string) (config.Controller, error) {
+	if explicit != "" {
+		for _, c := range controllers {
+			if c.Name == explicit {
+				return c, nil
+			}
+		}
+		return config.Controller{}, errgo.Newf("unknown controller %q", explicit)
+	}
+	var def *config.Controller
+	for i, c := range controllers {
+		if c.UserDomain != "" && strings.HasSuffix(user, c.UserDomain) {
+			return controllers[i], nil
+		}
+		if c.UserDomain == "" {
+			def = &controllers[i]
+		}
+	}
+	if def != nil {
+		return *def, nil
+	}
+	return config.Controller{}, errgo.Newf("no controller configured for user %q", user)
+}
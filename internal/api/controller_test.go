@@ -0,0 +1,73 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package api
+
+import (
+	"testing"
+
+	"github.com/CanonicalLtd/jujushell/config"
+)
+
+func TestPickController(t *testing.T) {
+	implicit := config.Controller{Name: "", JujuAddrs: []string{"implicit:17070"}}
+	external := config.Controller{Name: "external", UserDomain: "@external", JujuAddrs: []string{"external:17070"}}
+	explicitDefault := config.Controller{Name: "prod", JujuAddrs: []string{"prod:17070"}}
+
+	tests := []struct {
+		about       string
+		controllers []config.Controller
+		user        string
+		explicit    string
+		want        string
+		wantErr     string
+	}{{
+		about:       "explicit name wins",
+		controllers: []config.Controller{implicit, external},
+		user:        "alice@external",
+		explicit:    "external",
+		want:        "external",
+	}, {
+		about:       "unknown explicit name errors",
+		controllers: []config.Controller{implicit, external},
+		explicit:    "bogus",
+		wantErr:     `unknown controller "bogus"`,
+	}, {
+		about:       "user domain suffix match",
+		controllers: []config.Controller{implicit, external},
+		user:        "alice@external",
+		want:        "external",
+	}, {
+		about:       "falls back to the implicit default",
+		controllers: []config.Controller{implicit, external},
+		user:        "alice",
+		want:        "",
+	}, {
+		about:       "an explicitly configured default takes precedence over the implicit one",
+		controllers: []config.Controller{implicit, explicitDefault},
+		user:        "alice",
+		want:        "prod",
+	}, {
+		about:       "no controller configured for the user",
+		controllers: nil,
+		user:        "alice",
+		wantErr:     `no controller configured for user "alice"`,
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			got, err := pickController(test.controllers, test.user, test.explicit)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Name != test.want {
+				t.Fatalf("got controller %q, want %q", got.Name, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package api
+
+import (
+	lxd "github.com/lxc/lxd/client"
+	"gopkg.in/errgo.v1"
+
+	"github.com/CanonicalLtd/jujushell/config"
+)
+
+// connectLXD returns a client connected to the LXD server used to create
+// containers: a remote HTTPS server when lxdRemote is set, or the local
+// unix socket at socketPath otherwise. config.validate guarantees that
+// exactly one of the two is provided.
+func connectLXD(socketPath string, lxdRemote *config.LXDRemote) (lxd.ContainerServer, error) {
+	if lxdRemote != nil {
+		args := &lxd.ConnectionArgs{
+			TLSClientCert: lxdRemote.ClientCert,
+			TLSClientKey:  lxdRemote.ClientKey,
+			TLSServerCert: lxdRemote.ServerCert,
+		}
+		client, err := lxd.ConnectLXD("https://"+lxdRemote.Addr, args)
+		if err != nil {
+			return nil, errgo.Notef(err, "cannot connect to remote LXD server at %q", lxdRemote.Addr)
+		}
+		if lxdRemote.Project != "" {
+			client = client.UseProject(lxdRemote.Project)
+		}
+		return client, nil
+	}
+	client, err := lxd.ConnectLXDUnix(socketPath, nil)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot connect to LXD socket at %q", socketPath)
+	}
+	return client, nil
+}
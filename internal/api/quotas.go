@@ -0,0 +1,139 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package api
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/errgo.v1"
+
+	"github.com/CanonicalLtd/jujushell/config"
+)
+
+var (
+	containersActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "jujushell",
+		Name:      "containers_active",
+		Help:      "The number of containers currently running.",
+	})
+	containersCreatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "jujushell",
+		Name:      "containers_created_total",
+		Help:      "The total number of containers created.",
+	})
+	containersDestroyedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "jujushell",
+		Name:      "containers_destroyed_total",
+		Help:      "The total number of containers destroyed.",
+	})
+	sessionDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "jujushell",
+		Name:      "session_duration_seconds",
+		Help:      "The duration of shell sessions, in seconds.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	})
+	lxdCallLatencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "jujushell",
+		Name:      "lxd_call_latency_seconds",
+		Help:      "The latency of calls made to the LXD API, by call name.",
+	}, []string{"call"})
+	quotaRejectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "jujushell",
+		Name:      "quota_rejections_total",
+		Help:      "The total number of sessions rejected because of a quota, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		containersActive,
+		containersCreatedTotal,
+		containersDestroyedTotal,
+		sessionDurationSeconds,
+		lxdCallLatencySeconds,
+		quotaRejectionsTotal,
+	)
+}
+
+// quotaManager tracks in-progress sessions so that the limits described by
+// a config.Quotas can be enforced before a container is created. The
+// quotas function is called once per acquire, rather than captured once at
+// construction time, so that a configuration reload takes effect for new
+// sessions without requiring a restart.
+type quotaManager struct {
+	quotas func() config.Quotas
+
+	mu     sync.Mutex
+	total  int
+	byUser map[string]int
+	byIP   map[string]int
+}
+
+// newQuotaManager returns a quotaManager enforcing the quotas returned by
+// quotas on every call.
+func newQuotaManager(quotas func() config.Quotas) *quotaManager {
+	return &quotaManager{
+		quotas: quotas,
+		byUser: make(map[string]int),
+		byIP:   make(map[string]int),
+	}
+}
+
+// acquire reserves a slot for a new session for the given user and source
+// IP, returning an error if doing so would exceed a configured quota. Each
+// successful call to acquire must be matched by a call to release.
+func (m *quotaManager) acquire(user, ip string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	quotas := m.quotas()
+	if q := quotas.MaxContainers; q > 0 && m.total >= q {
+		quotaRejectionsTotal.WithLabelValues("max-containers").Inc()
+		return errgo.Newf("quota exceeded: at most %d containers may be running at once", q)
+	}
+	if q := quotas.MaxContainersPerUser; q > 0 && m.byUser[user] >= q {
+		quotaRejectionsTotal.WithLabelValues("max-containers-per-user").Inc()
+		return errgo.Newf("quota exceeded: user %q may have at most %d containers running at once", user, q)
+	}
+	if q := quotas.MaxSessionsPerIP; q > 0 && m.byIP[ip] >= q {
+		quotaRejectionsTotal.WithLabelValues("max-sessions-per-ip").Inc()
+		return errgo.Newf("quota exceeded: at most %d sessions may be started from %q at once", q, ip)
+	}
+	m.total++
+	m.byUser[user]++
+	m.byIP[ip]++
+	return nil
+}
+
+// release frees the slot reserved by a previous call to acquire for the
+// given user and source IP.
+func (m *quotaManager) release(user, ip string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total--
+	m.byUser[user]--
+	if m.byUser[user] <= 0 {
+		delete(m.byUser, user)
+	}
+	m.byIP[ip]--
+	if m.byIP[ip] <= 0 {
+		delete(m.byIP, ip)
+	}
+}
+
+// limits returns the LXD "limits.cpu" and "limits.memory" config keys that
+// should be applied to a new container under these quotas, as extra
+// container configuration entries.
+func (m *quotaManager) limits() map[string]string {
+	quotas := m.quotas()
+	limits := make(map[string]string)
+	if quotas.MaxCPU > 0 {
+		limits["limits.cpu"] = strconv.Itoa(quotas.MaxCPU)
+	}
+	if quotas.MaxMemory != "" {
+		limits["limits.memory"] = quotas.MaxMemory
+	}
+	return limits
+}
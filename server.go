@@ -5,25 +5,226 @@ package jujushell
 
 import (
 	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"gopkg.in/errgo.v1"
+
+	"github.com/CanonicalLtd/jujushell/config"
 	"github.com/CanonicalLtd/jujushell/internal/api"
 )
 
-// NewServer returns a new handler that handles juju shell requests.
+// NewServer returns a new handler that handles juju shell requests. The
+// returned handler also implements Reloader, and can have its reloadable
+// parameters swapped at runtime with Reload.
 func NewServer(p Params) (http.Handler, error) {
+	s := &server{}
+	s.params.Store(p)
 	mux := http.NewServeMux()
-	if err := api.Register(mux, p.JujuAddrs, p.JujuCert, p.ImageName); err != nil {
+	if err := api.Register(mux, s.controllers, s.allowedUsers, s.profiles, s.imageName, s.sessionTimeout, s.welcomeMessage, p.LXDSocketPath, p.LXDRemote, s.quotas); err != nil {
 		return nil, err
 	}
-	return mux, nil
+	mux.Handle("/metrics", promhttp.Handler())
+	s.mux = mux
+	return s, nil
+}
+
+// Reloader is implemented by handlers returned by NewServer, allowing their
+// reloadable parameters to be swapped at runtime.
+type Reloader interface {
+	Reload(p Params) error
+}
+
+// server is the http.Handler returned by NewServer. Its reloadable fields
+// are held behind an atomic.Value so that a Reload can take effect for new
+// sessions without disturbing container sessions already in progress.
+type server struct {
+	mux    http.Handler
+	params atomic.Value // holds a Params value.
+}
+
+// ServeHTTP implements http.Handler.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Reload swaps the reloadable fields of the server's parameters for the
+// ones in p, validating p first and rejecting any change to a field that
+// cannot be altered without restarting the process. Sessions already in
+// progress are not affected; only new sessions pick up the new parameters.
+func (s *server) Reload(p Params) error {
+	if err := validateParams(p); err != nil {
+		return errgo.Notef(err, "invalid configuration")
+	}
+	current := s.params.Load().(Params)
+	if p.Port != current.Port {
+		return errgo.New("cannot change port without restarting")
+	}
+	if p.DNSName != current.DNSName {
+		return errgo.New("cannot change dns-name without restarting")
+	}
+	if p.TLSCert != current.TLSCert || p.TLSKey != current.TLSKey {
+		return errgo.New("cannot change tls-cert or tls-key without restarting")
+	}
+	if p.LXDSocketPath != current.LXDSocketPath {
+		return errgo.New("cannot change lxd-socket-path without restarting")
+	}
+	if !lxdRemoteEqual(p.LXDRemote, current.LXDRemote) {
+		return errgo.New("cannot change lxd-remote without restarting")
+	}
+	s.params.Store(p)
+	return nil
+}
+
+// validateParams validates the reloadable fields of p using the rules
+// config.validate applies when reading a configuration file, except that
+// JujuAddrs may be empty when at least one controller is listed in
+// Controllers.
+func validateParams(p Params) error {
+	if p.ImageName == "" {
+		return errgo.New("missing fields: image-name")
+	}
+	if len(p.JujuAddrs) == 0 && len(p.Controllers) == 0 {
+		return errgo.New("missing fields: juju-addrs")
+	}
+	if len(p.Profiles) == 0 {
+		return errgo.New("missing fields: profiles")
+	}
+	if p.SessionTimeout < 0 {
+		return errgo.New("cannot specify a negative session timeout")
+	}
+	if err := config.ValidateControllers(p.Controllers); err != nil {
+		return errgo.Notef(err, "invalid controllers")
+	}
+	if err := config.ValidateQuotas(p.Quotas); err != nil {
+		return errgo.Notef(err, "invalid quotas")
+	}
+	return nil
+}
+
+func (s *server) controllers() []config.Controller { return controllers(s.params.Load().(Params)) }
+func (s *server) allowedUsers() []string           { return s.params.Load().(Params).AllowedUsers }
+func (s *server) profiles() []string               { return s.params.Load().(Params).Profiles }
+func (s *server) imageName() string                { return s.params.Load().(Params).ImageName }
+func (s *server) sessionTimeout() int              { return s.params.Load().(Params).SessionTimeout }
+func (s *server) welcomeMessage() string           { return s.params.Load().(Params).WelcomeMessage }
+func (s *server) quotas() config.Quotas            { return s.params.Load().(Params).Quotas }
+
+// lxdRemoteEqual reports whether a and b describe the same remote LXD
+// server, treating two nil values as equal.
+func lxdRemoteEqual(a, b *config.LXDRemote) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// controllers returns the list of controllers that the server can dispatch
+// sessions to: the implicit default controller built from the top level
+// Juju parameters, followed by any additional controllers configured in
+// Params.Controllers.
+func controllers(p Params) []config.Controller {
+	def := config.Controller{
+		JujuAddrs: p.JujuAddrs,
+		JujuCert:  p.JujuCert,
+		ImageName: p.ImageName,
+	}
+	return append([]config.Controller{def}, p.Controllers...)
 }
 
 // Params holds parameters for running the server.
 type Params struct {
+	// AllowedUsers optionally holds a list of names of users allowed to use
+	// the service. An empty list means that all users who can authenticate
+	// against the controller are allowed.
+	AllowedUsers []string
+	// Controllers optionally holds additional Juju controllers that the
+	// server can dispatch incoming shell sessions to. An implicit controller
+	// built from ImageName, JujuAddrs and JujuCert is always available as
+	// well; when Controllers is empty, it is the only one.
+	Controllers []config.Controller
+	// DNSName optionally holds the DNS name used for Let's Encrypt. This
+	// field cannot be changed by a Reload.
+	DNSName string
 	// ImageName holds the name of the LXD image to use to create containers.
 	ImageName string
 	// JujuAddrs holds the addresses of the current Juju controller.
 	JujuAddrs []string
 	// JujuCert holds the controller CA certificate in PEM format.
 	JujuCert string
+	// LXDRemote optionally holds the connection details of a remote LXD
+	// server to use instead of a local unix socket. Exactly one of
+	// LXDSocketPath and LXDRemote must be set. This field cannot be
+	// changed by a Reload.
+	LXDRemote *config.LXDRemote
+	// LXDSocketPath holds the path to the LXD unix socket. This field
+	// cannot be changed by a Reload.
+	LXDSocketPath string
+	// Port holds the port on which the server is listening. This field
+	// cannot be changed by a Reload.
+	Port int
+	// Profiles holds the LXD profiles to use when launching containers.
+	Profiles []string
+	// Quotas optionally holds limits on the resources a user or source IP
+	// can consume.
+	Quotas config.Quotas
+	// SessionTimeout holds the number of minutes of inactivity to wait
+	// before expiring a session and stopping the container instance.
+	SessionTimeout int
+	// TLSCert and TLSKey optionally hold the TLS info the server is
+	// running with. These fields cannot be changed by a Reload.
+	TLSCert string
+	TLSKey  string
+	// WelcomeMessage optionally holds a message to be displayed when users
+	// start the shell session.
+	WelcomeMessage string
+}
+
+// ParamsFromConfig builds the Params used to run the server from a parsed
+// configuration file.
+func ParamsFromConfig(c *config.Config) Params {
+	return Params{
+		AllowedUsers:   c.AllowedUsers,
+		Controllers:    c.Controllers,
+		DNSName:        c.DNSName,
+		ImageName:      c.ImageName,
+		JujuAddrs:      c.JujuAddrs,
+		JujuCert:       c.JujuCert,
+		LXDRemote:      c.LXDRemote,
+		LXDSocketPath:  c.LXDSocketPath,
+		Port:           c.Port,
+		Profiles:       c.Profiles,
+		Quotas:         c.Quotas,
+		SessionTimeout: c.SessionTimeout,
+		TLSCert:        c.TLSCert,
+		TLSKey:         c.TLSKey,
+		WelcomeMessage: c.WelcomeMessage,
+	}
+}
+
+// ReloadOnSIGHUP installs a signal handler that, on receiving SIGHUP,
+// re-reads the configuration file at path and reloads it into r. Errors
+// encountered while reloading are logged but do not stop the server or
+// the signal handler.
+func ReloadOnSIGHUP(r Reloader, path string, logger *zap.Logger) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			c, err := config.Read(path)
+			if err != nil {
+				logger.Error("cannot reload configuration", zap.Error(err))
+				continue
+			}
+			if err := r.Reload(ParamsFromConfig(c)); err != nil {
+				logger.Error("cannot reload configuration", zap.Error(err))
+				continue
+			}
+			logger.Info("configuration reloaded")
+		}
+	}()
 }
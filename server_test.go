@@ -0,0 +1,137 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package jujushell
+
+import (
+	"testing"
+
+	"github.com/CanonicalLtd/jujushell/config"
+)
+
+func baseParams() Params {
+	return Params{
+		ImageName:     "image",
+		JujuAddrs:     []string{"1.2.3.4:17070"},
+		Profiles:      []string{"default"},
+		LXDSocketPath: "/var/lib/lxd/unix.socket",
+		Port:          8047,
+	}
+}
+
+func TestReloadAcceptsValidChanges(t *testing.T) {
+	h, err := NewServer(baseParams())
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	p := baseParams()
+	p.WelcomeMessage = "hello"
+	p.AllowedUsers = []string{"alice"}
+	if err := h.(Reloader).Reload(p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	h, err := NewServer(baseParams())
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	p := baseParams()
+	p.ImageName = ""
+	if err := h.(Reloader).Reload(p); err == nil {
+		t.Fatal("expected an error for a missing image-name")
+	}
+}
+
+func TestReloadRejectsImmutableFieldChanges(t *testing.T) {
+	tests := []struct {
+		about  string
+		mutate func(*Params)
+	}{{
+		about:  "port",
+		mutate: func(p *Params) { p.Port++ },
+	}, {
+		about:  "dns-name",
+		mutate: func(p *Params) { p.DNSName = "example.com" },
+	}, {
+		about:  "tls-cert",
+		mutate: func(p *Params) { p.TLSCert = "cert" },
+	}, {
+		about:  "tls-key",
+		mutate: func(p *Params) { p.TLSKey = "key" },
+	}, {
+		about:  "lxd-socket-path",
+		mutate: func(p *Params) { p.LXDSocketPath = "/other/socket" },
+	}, {
+		about: "lxd-remote",
+		mutate: func(p *Params) {
+			p.LXDSocketPath = ""
+			p.LXDRemote = &config.LXDRemote{Addr: "lxd.example.com:8443"}
+		},
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			h, err := NewServer(baseParams())
+			if err != nil {
+				t.Fatalf("NewServer failed: %v", err)
+			}
+			p := baseParams()
+			test.mutate(&p)
+			if err := h.(Reloader).Reload(p); err == nil {
+				t.Fatalf("expected Reload to reject a change to %s", test.about)
+			}
+		})
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	tests := []struct {
+		about   string
+		mutate  func(*Params)
+		wantErr bool
+	}{{
+		about: "valid params",
+	}, {
+		about:   "missing image name",
+		mutate:  func(p *Params) { p.ImageName = "" },
+		wantErr: true,
+	}, {
+		about:   "missing juju addrs and controllers",
+		mutate:  func(p *Params) { p.JujuAddrs = nil },
+		wantErr: true,
+	}, {
+		about:   "missing profiles",
+		mutate:  func(p *Params) { p.Profiles = nil },
+		wantErr: true,
+	}, {
+		about:   "negative session timeout",
+		mutate:  func(p *Params) { p.SessionTimeout = -1 },
+		wantErr: true,
+	}, {
+		about:   "negative quota",
+		mutate:  func(p *Params) { p.Quotas.MaxContainers = -1 },
+		wantErr: true,
+	}, {
+		about: "juju addrs can come from an additional controller alone",
+		mutate: func(p *Params) {
+			p.JujuAddrs = nil
+			p.Controllers = []config.Controller{{Name: "a", JujuAddrs: []string{"1.2.3.4:17070"}}}
+		},
+	}}
+	for _, test := range tests {
+		t.Run(test.about, func(t *testing.T) {
+			p := baseParams()
+			if test.mutate != nil {
+				test.mutate(&p)
+			}
+			err := validateParams(p)
+			if test.wantErr && err == nil {
+				t.Fatal("expected an error")
+			}
+			if !test.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}